@@ -0,0 +1,146 @@
+package common
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"strings"
+)
+
+// checksumHashes maps a checksum hex digest length to the hash
+// implementation that produces digests of that length, used to
+// auto-detect the algorithm of an entry in a checksum file.
+var checksumHashes = map[int]func() hash.Hash{
+	32:  md5.New,
+	40:  sha1.New,
+	64:  sha256.New,
+	128: sha512.New,
+}
+
+// checksumTypes maps a ChecksumType hint to its hash implementation.
+var checksumTypes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// parseChecksumFile locates the checksum entry for filename within the
+// contents of a checksum manifest and returns its decoded digest along
+// with the hash constructor to verify it with.
+//
+// Three formats are understood:
+//
+//	BSD:       SHA256 (filename) = hexdigest
+//	GNU:       hexdigest  filename
+//	GNU (bin): hexdigest *filename
+//	single:    hexdigest
+//
+// A bare hexdigest with no filename is accepted as a match for any
+// filename, since some upstreams publish a manifest with exactly one
+// entry and no filename column.
+func parseChecksumFile(body []byte, filename, checksumType string) ([]byte, func() hash.Hash, error) {
+	body = stripBOM(body)
+	filename = filepath.Base(filename)
+
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		digestHex, name, ok := parseChecksumLine(line)
+		if !ok {
+			continue
+		}
+
+		if name != "" && filepath.Base(name) != filename {
+			continue
+		}
+
+		digest, err := hex.DecodeString(digestHex)
+		if err != nil {
+			continue
+		}
+
+		newHash, err := checksumHashFor(checksumType, len(digestHex))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return digest, newHash, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return nil, nil, fmt.Errorf("checksum: no entry for %q found in manifest", filename)
+}
+
+// parseChecksumLine extracts the hex digest and, if present, the
+// filename from a single line of a BSD- or GNU-style checksum file.
+// name is "" for a single bare hex digest.
+func parseChecksumLine(line string) (digestHex, name string, ok bool) {
+	// BSD style: "SHA256 (filename) = hexdigest"
+	if idx := strings.Index(line, "("); idx >= 0 {
+		end := strings.Index(line, ")")
+		if end > idx {
+			eq := strings.LastIndex(line, "=")
+			if eq > end {
+				return strings.TrimSpace(line[eq+1:]), line[idx+1 : end], true
+			}
+		}
+	}
+
+	// GNU style: "hexdigest  filename" or "hexdigest *filename"
+	fields := strings.Fields(line)
+	if len(fields) >= 2 {
+		return fields[0], strings.TrimPrefix(fields[1], "*"), true
+	}
+
+	// Single bare digest, no filename.
+	if len(fields) == 1 {
+		return fields[0], "", true
+	}
+
+	return "", "", false
+}
+
+// checksumHashFor resolves the hash implementation to use for a digest,
+// preferring an explicit checksumType hint and falling back to
+// auto-detection from the digest's hex length.
+func checksumHashFor(checksumType string, hexLen int) (func() hash.Hash, error) {
+	checksumType = strings.ToLower(checksumType)
+	if checksumType != "" && checksumType != "file" {
+		newHash, ok := checksumTypes[checksumType]
+		if !ok {
+			return nil, fmt.Errorf("checksum: unknown checksum type %q", checksumType)
+		}
+		return newHash, nil
+	}
+
+	newHash, ok := checksumHashes[hexLen]
+	if !ok {
+		return nil, fmt.Errorf("checksum: could not determine algorithm for a %d-character digest", hexLen)
+	}
+
+	return newHash, nil
+}
+
+// stripBOM removes a leading UTF-8 byte-order mark, which several
+// upstream checksum manifests include.
+func stripBOM(b []byte) []byte {
+	bom := []byte{0xEF, 0xBB, 0xBF}
+	if len(b) >= len(bom) && b[0] == bom[0] && b[1] == bom[1] && b[2] == bom[2] {
+		return b[len(bom):]
+	}
+	return b
+}
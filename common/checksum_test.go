@@ -0,0 +1,149 @@
+package common
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseChecksumFile_BSD(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte("SHA256 (artifact.iso) = " + digest + "\n")
+
+	got, newHash, err := parseChecksumFile(body, "artifact.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+	if newHash().Size() != sha256.Size {
+		t.Fatalf("expected sha256 to be auto-detected from digest length")
+	}
+}
+
+func TestParseChecksumFile_GNU(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + "  artifact.iso\n")
+
+	got, _, err := parseChecksumFile(body, "artifact.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+}
+
+func TestParseChecksumFile_GNUBinaryMarker(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + " *artifact.iso\n")
+
+	got, _, err := parseChecksumFile(body, "artifact.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+}
+
+func TestParseChecksumFile_SingleBareDigest(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + "\n")
+
+	got, _, err := parseChecksumFile(body, "anything.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+}
+
+func TestParseChecksumFile_StripsBOM(t *testing.T) {
+	digest := sha256Hex("hello")
+	bom := []byte{0xEF, 0xBB, 0xBF}
+	body := append(bom, []byte(digest+"  artifact.iso\n")...)
+
+	got, _, err := parseChecksumFile(body, "artifact.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+}
+
+func TestParseChecksumFile_MatchesByBaseName(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + "  ./nested/dir/artifact.iso\n")
+
+	got, _, err := parseChecksumFile(body, "/somewhere/else/artifact.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+}
+
+func TestParseChecksumFile_SkipsCommentsAndBlankLines(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte("# generated by upstream\n\n" + digest + "  artifact.iso\n")
+
+	got, _, err := parseChecksumFile(body, "artifact.iso", "")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if hex.EncodeToString(got) != digest {
+		t.Fatalf("digest = %x, want %s", got, digest)
+	}
+}
+
+func TestParseChecksumFile_NoMatchingEntry(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + "  other-file.iso\n")
+
+	if _, _, err := parseChecksumFile(body, "artifact.iso", ""); err == nil {
+		t.Fatal("expected an error when no entry matches the filename")
+	}
+}
+
+func TestParseChecksumFile_ChecksumTypeHintOverridesLength(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + "  artifact.iso\n")
+
+	// A 64-character digest would auto-detect as sha256; the sha512 hint
+	// must win over that.
+	_, newHash, err := parseChecksumFile(body, "artifact.iso", "sha512")
+	if err != nil {
+		t.Fatalf("parseChecksumFile: %v", err)
+	}
+	if newHash().Size() != sha512.Size {
+		t.Fatalf("expected the sha512 hint to be honored over the digest length")
+	}
+}
+
+func TestParseChecksumFile_UnknownChecksumType(t *testing.T) {
+	digest := sha256Hex("hello")
+	body := []byte(digest + "  artifact.iso\n")
+
+	if _, _, err := parseChecksumFile(body, "artifact.iso", "sha3-512"); err == nil {
+		t.Fatal("expected an error for an unrecognized ChecksumType hint")
+	}
+}
+
+func TestParseChecksumFile_UnrecognizedDigestLength(t *testing.T) {
+	body := []byte("deadbeef  artifact.iso\n")
+
+	if _, _, err := parseChecksumFile(body, "artifact.iso", ""); err == nil {
+		t.Fatal("expected an error when the digest length matches no known algorithm")
+	}
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Verifier is implemented by detached-signature schemes that can prove a
+// blob of bytes was produced by a trusted key. It exists so that
+// alternate schemes (minisign, cosign blob, etc.) can be plugged into a
+// DownloadClient in place of the default Ed25519 distsign-style scheme.
+type Verifier interface {
+	// Verify checks sig against data and returns nil if it is a valid
+	// signature, or an error describing why verification failed.
+	Verify(data, sig []byte) error
+}
+
+// signingKey is a single entry in a signed signing-key manifest: a
+// rotating key that is itself authenticated by one of the root keys
+// baked into Packer, along with the window during which it is valid.
+type signingKey struct {
+	KeyID     string    `json:"key_id"`
+	PublicKey []byte    `json:"public_key"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// ed25519Verifier is the default Verifier, used to check both the
+// signing-key manifest (against the root keys) and the artifact
+// signature (against a currently-valid signing key).
+type ed25519Verifier struct {
+	keys [][]byte
+}
+
+func (v *ed25519Verifier) Verify(data, sig []byte) error {
+	for _, key := range v.keys {
+		if len(key) != ed25519.PublicKeySize {
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("distsign: signature did not verify against any known key")
+}
+
+// defaultVerifierFactory constructs the default Ed25519 Verifier used
+// when DownloadConfig.NewVerifier is not set.
+func defaultVerifierFactory(keys [][]byte) Verifier {
+	return &ed25519Verifier{keys: keys}
+}
+
+// fetchSigningKeys retrieves and verifies the signing-key manifest at
+// SigningKeysURL against the pinned root keys using newVerifier,
+// returning the list of keys that are currently valid (i.e. within
+// their not-before/not-after window as of now).
+func fetchSigningKeys(client *http.Client, manifestURL string, rootKeys [][]byte, newVerifier func([][]byte) Verifier) ([]signingKey, error) {
+	body, err := httpGetBody(client, manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("distsign: fetching signing-key manifest: %w", err)
+	}
+
+	sigBody, err := httpGetBody(client, manifestURL+".sig")
+	if err != nil {
+		return nil, fmt.Errorf("distsign: fetching signing-key manifest signature: %w", err)
+	}
+
+	root := newVerifier(rootKeys)
+	if err := root.Verify(body, sigBody); err != nil {
+		return nil, fmt.Errorf("distsign: signing-key manifest failed root verification: %w", err)
+	}
+
+	var manifest struct {
+		Keys []signingKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("distsign: parsing signing-key manifest: %w", err)
+	}
+
+	now := time.Now()
+	var valid []signingKey
+	for _, k := range manifest.Keys {
+		if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+			continue
+		}
+		if !k.NotAfter.IsZero() && now.After(k.NotAfter) {
+			continue
+		}
+		valid = append(valid, k)
+	}
+
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("distsign: signing-key manifest contains no currently valid keys")
+	}
+
+	return valid, nil
+}
+
+// verifyArtifactSignature fetches the detached signature for an artifact
+// (from SignatureURL, or "<Url>.sig" if unset) and checks it against any
+// of the currently-valid signing keys using newVerifier.
+func verifyArtifactSignature(client *http.Client, artifactURL, signatureURL string, data []byte, keys []signingKey, newVerifier func([][]byte) Verifier) error {
+	if signatureURL == "" {
+		signatureURL = artifactURL + ".sig"
+	}
+
+	sig, err := httpGetBody(client, signatureURL)
+	if err != nil {
+		return fmt.Errorf("distsign: fetching artifact signature: %w", err)
+	}
+
+	var pubKeys [][]byte
+	for _, k := range keys {
+		pubKeys = append(pubKeys, k.PublicKey)
+	}
+
+	v := newVerifier(pubKeys)
+	if err := v.Verify(data, sig); err != nil {
+		return fmt.Errorf("distsign: artifact failed signature verification: %w", err)
+	}
+
+	return nil
+}
+
+func httpGetBody(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, url)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 10<<20))
+}
@@ -0,0 +1,211 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the given path -> body mapping over HTTP.
+func newTestServer(t *testing.T, paths map[string][]byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := paths[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func mustMarshalManifest(t *testing.T, keys []signingKey) []byte {
+	t.Helper()
+	body, err := json.Marshal(struct {
+		Keys []signingKey `json:"keys"`
+	}{Keys: keys})
+	if err != nil {
+		t.Fatalf("marshal manifest: %v", err)
+	}
+	return body
+}
+
+func TestFetchSigningKeys_KeyRotation(t *testing.T) {
+	rootPub, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate root key: %v", err)
+	}
+
+	oldPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate old key: %v", err)
+	}
+	newPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate new key: %v", err)
+	}
+
+	now := time.Now()
+	manifest := mustMarshalManifest(t, []signingKey{
+		{
+			KeyID:     "old",
+			PublicKey: oldPub,
+			NotBefore: now.Add(-48 * time.Hour),
+			NotAfter:  now.Add(-24 * time.Hour), // rotated out
+		},
+		{
+			KeyID:     "new",
+			PublicKey: newPub,
+			NotBefore: now.Add(-time.Hour), // currently valid
+		},
+	})
+	sig := ed25519.Sign(rootPriv, manifest)
+
+	srv := newTestServer(t, map[string][]byte{
+		"/manifest":     manifest,
+		"/manifest.sig": sig,
+	})
+
+	keys, err := fetchSigningKeys(srv.Client(), srv.URL+"/manifest", [][]byte{rootPub}, defaultVerifierFactory)
+	if err != nil {
+		t.Fatalf("fetchSigningKeys: %v", err)
+	}
+
+	if len(keys) != 1 || keys[0].KeyID != "new" {
+		t.Fatalf("expected only the rotated-in key to be returned, got %+v", keys)
+	}
+}
+
+func TestFetchSigningKeys_AllExpired(t *testing.T) {
+	rootPub, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate root key: %v", err)
+	}
+	expiredPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate expired key: %v", err)
+	}
+
+	now := time.Now()
+	manifest := mustMarshalManifest(t, []signingKey{
+		{
+			KeyID:     "expired",
+			PublicKey: expiredPub,
+			NotBefore: now.Add(-48 * time.Hour),
+			NotAfter:  now.Add(-time.Hour),
+		},
+	})
+	sig := ed25519.Sign(rootPriv, manifest)
+
+	srv := newTestServer(t, map[string][]byte{
+		"/manifest":     manifest,
+		"/manifest.sig": sig,
+	})
+
+	_, err = fetchSigningKeys(srv.Client(), srv.URL+"/manifest", [][]byte{rootPub}, defaultVerifierFactory)
+	if err == nil {
+		t.Fatal("expected an error when every signing key has expired, got nil")
+	}
+	if !strings.Contains(err.Error(), "no currently valid keys") {
+		t.Fatalf("expected a no-currently-valid-keys error, got: %v", err)
+	}
+}
+
+func TestFetchSigningKeys_TamperedManifest(t *testing.T) {
+	rootPub, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate root key: %v", err)
+	}
+	keyPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	manifest := mustMarshalManifest(t, []signingKey{{KeyID: "k", PublicKey: keyPub}})
+	sig := ed25519.Sign(rootPriv, manifest)
+
+	tampered := append([]byte{}, manifest...)
+	tampered = append(tampered, ' ') // a byte appended after the manifest was signed
+
+	srv := newTestServer(t, map[string][]byte{
+		"/manifest":     tampered,
+		"/manifest.sig": sig,
+	})
+
+	_, err = fetchSigningKeys(srv.Client(), srv.URL+"/manifest", [][]byte{rootPub}, defaultVerifierFactory)
+	if err == nil {
+		t.Fatal("expected a tampered manifest to fail root verification")
+	}
+}
+
+func TestVerifyArtifactSignature_Valid(t *testing.T) {
+	keyPub, keyPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	data := []byte("artifact bytes")
+	sig := ed25519.Sign(keyPriv, data)
+
+	srv := newTestServer(t, map[string][]byte{
+		"/artifact.sig": sig,
+	})
+
+	keys := []signingKey{{KeyID: "k", PublicKey: keyPub}}
+	if err := verifyArtifactSignature(srv.Client(), srv.URL+"/artifact", "", data, keys, defaultVerifierFactory); err != nil {
+		t.Fatalf("verifyArtifactSignature: %v", err)
+	}
+}
+
+func TestVerifyArtifactSignature_TamperedArtifact(t *testing.T) {
+	keyPub, keyPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	data := []byte("artifact bytes")
+	sig := ed25519.Sign(keyPriv, data)
+
+	srv := newTestServer(t, map[string][]byte{
+		"/artifact.sig": sig,
+	})
+
+	keys := []signingKey{{KeyID: "k", PublicKey: keyPub}}
+	tampered := []byte("artifact bytes, but tampered with")
+	err = verifyArtifactSignature(srv.Client(), srv.URL+"/artifact", "", tampered, keys, defaultVerifierFactory)
+	if err == nil {
+		t.Fatal("expected a tampered artifact to fail signature verification")
+	}
+}
+
+func TestVerifyArtifactSignature_NoValidKeys(t *testing.T) {
+	_, keyPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate other key: %v", err)
+	}
+
+	data := []byte("artifact bytes")
+	sig := ed25519.Sign(keyPriv, data)
+
+	srv := newTestServer(t, map[string][]byte{
+		"/artifact.sig": sig,
+	})
+
+	// keys only contains a key unrelated to the one that actually signed
+	// the artifact, simulating a signature made by a key that was never
+	// part of the currently-valid set (e.g. one rotated out).
+	keys := []signingKey{{KeyID: "other", PublicKey: otherPub}}
+	if err := verifyArtifactSignature(srv.Client(), srv.URL+"/artifact", "", data, keys, defaultVerifierFactory); err == nil {
+		t.Fatal("expected verification to fail against an unrelated key set")
+	}
+}
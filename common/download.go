@@ -1,19 +1,21 @@
 package common
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
-	"crypto/sha512"
+	"bytes"
+	"context"
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
+	"sync/atomic"
 
 	getter "github.com/hashicorp/go-getter"
+	"golang.org/x/time/rate"
 )
 
 // DownloadConfig is the configuration given to instantiate a new
@@ -45,25 +47,152 @@ type DownloadConfig struct {
 	// What to use for the user agent for HTTP requests. If set to "", use the
 	// default user agent provided by Go.
 	UserAgent string
+
+	// SigningRootKeys is a set of Ed25519 public keys shipped with Packer
+	// that are trusted to sign the signing-key manifest at
+	// SigningKeysURL. If set, the downloaded artifact must carry a valid
+	// detached signature traceable back to one of these keys before it
+	// is accepted, in addition to any Hash/Checksum check.
+	SigningRootKeys [][]byte
+
+	// SigningKeysURL is the location of a signed manifest listing the
+	// signing keys that are currently authorized to sign artifacts. It
+	// is fetched once per download and verified against
+	// SigningRootKeys; its own detached signature is expected at
+	// SigningKeysURL+".sig".
+	SigningKeysURL string
+
+	// SignatureURL is the location of the detached signature over the
+	// downloaded artifact. If empty and SigningRootKeys is set, it
+	// defaults to Url+".sig".
+	SignatureURL string
+
+	// NewVerifier, if set, constructs the Verifier used to check the
+	// signing-key manifest against SigningRootKeys and the artifact
+	// signature against the currently-valid signing keys, letting
+	// callers plug in an alternate scheme (minisign, cosign blob, etc.)
+	// in place of the default Ed25519 Verifier. If nil, the default
+	// Ed25519 Verifier is used.
+	NewVerifier func(keys [][]byte) Verifier
+
+	// Concurrency is the number of parallel ranged GETs to use when the
+	// server supports them. Values <= 1 disable segmented downloads and
+	// fall back to the single-stream resume path.
+	Concurrency int
+
+	// ChunkSize is the size in bytes of each ranged GET when a
+	// segmented download is used. If zero, a reasonable default is used.
+	ChunkSize int64
+
+	// RateLimit caps the aggregate download speed, in bytes/sec, across
+	// all workers of a segmented download. Zero means unlimited.
+	RateLimit int64
+
+	// Ctx, if set, is used to cancel in-flight HTTP requests. If nil, a
+	// cancelable background context is created for the download and
+	// wired up to DownloadClient.Cancel.
+	Ctx context.Context
+
+	// ChecksumURL, if set, points at a remote checksum manifest (BSD,
+	// GNU coreutils, or single-line hex) to fetch and search for an
+	// entry matching the downloaded filename, populating Hash/Checksum
+	// automatically instead of requiring them to be set by hand.
+	ChecksumURL string
+
+	// ChecksumType hints at the algorithm used in the manifest at
+	// ChecksumURL ("md5", "sha1", "sha256", "sha512", or "file" for
+	// auto-detect). If empty, the algorithm is auto-detected from the
+	// digest's hex length.
+	ChecksumType string
+
+	// ChecksumSignatureURL, if set, is a detached signature over the
+	// manifest at ChecksumURL, verified against SigningRootKeys before
+	// the manifest is trusted.
+	ChecksumSignatureURL string
+
+	// Transport, if set, is used for all HTTP requests this download
+	// makes instead of a per-download http.Transport. DownloadBatch
+	// sets this to a transport shared across every item in the batch
+	// so they pool connections to the same host rather than each
+	// opening their own.
+	Transport http.RoundTripper
+
+	// RateLimiter, if set, is used instead of constructing a new
+	// limiter from RateLimit, letting several downloads (e.g. the
+	// items of a DownloadBatch) throttle against one shared budget.
+	RateLimiter *rate.Limiter
 }
 
 // A DownloadClient helps download, verify checksums, etc.
 type DownloadClient struct {
-	config     *DownloadConfig
+	config *DownloadConfig
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
 	downloader Downloader
 }
 
+// setDownloader records the Downloader fetch is about to use, guarded by
+// mu since it's read concurrently by Cancel, PercentProgress, and a
+// DownloadBatch's BatchProgress poller.
+func (d *DownloadClient) setDownloader(downloader Downloader) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downloader = downloader
+}
+
+// getDownloader returns the Downloader currently in use, or nil before
+// the download has started.
+func (d *DownloadClient) getDownloader() Downloader {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.downloader
+}
+
 // NewDownloadClient returns a new DownloadClient for the given
 // configuration.
 func NewDownloadClient(c *DownloadConfig) *DownloadClient {
+	ctx := c.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
 	if c.DownloaderMap == nil {
 		c.DownloaderMap = map[string]Downloader{
-			"http":  &HTTPDownloader{userAgent: c.UserAgent},
-			"https": &HTTPDownloader{userAgent: c.UserAgent},
+			"http": &HTTPDownloader{
+				userAgent:   c.UserAgent,
+				concurrency: c.Concurrency,
+				chunkSize:   c.ChunkSize,
+				rateLimit:   c.RateLimit,
+				rateLimiter: c.RateLimiter,
+				transport:   c.Transport,
+				ctx:         ctx,
+			},
+			"https": &HTTPDownloader{
+				userAgent:   c.UserAgent,
+				concurrency: c.Concurrency,
+				chunkSize:   c.ChunkSize,
+				rateLimit:   c.RateLimit,
+				rateLimiter: c.RateLimiter,
+				transport:   c.Transport,
+				ctx:         ctx,
+			},
 		}
 	}
 
-	return &DownloadClient{config: c}
+	return &DownloadClient{config: c, cancel: cancel}
+}
+
+// NewDownloadClientWithSigning returns a new DownloadClient for the given
+// configuration that additionally requires the downloaded artifact to
+// carry a valid signature traceable back to rootKeys, as described by
+// DownloadConfig.SigningRootKeys. It is a convenience wrapper around
+// NewDownloadClient for callers that don't otherwise need to set
+// SigningRootKeys by hand.
+func NewDownloadClientWithSigning(c *DownloadConfig, rootKeys [][]byte) *DownloadClient {
+	c.SigningRootKeys = rootKeys
+	return NewDownloadClient(c)
 }
 
 // A downloader is responsible for actually taking a remote URL and
@@ -76,7 +205,12 @@ type Downloader interface {
 }
 
 func (d *DownloadClient) Cancel() {
-	// TODO(mitchellh): Implement
+	if downloader := d.getDownloader(); downloader != nil {
+		downloader.Cancel()
+	}
+	if d.cancel != nil {
+		d.cancel()
+	}
 }
 
 func (d *DownloadClient) Get() (string, error) {
@@ -84,106 +218,469 @@ func (d *DownloadClient) Get() (string, error) {
 	if err != nil {
 		return "", err
 	}
+
+	if d.config.ChecksumURL != "" && (d.config.Hash == nil || len(d.config.Checksum) == 0) {
+		if err := d.resolveChecksumFromURL(); err != nil {
+			return "", err
+		}
+	}
+
+	// Every check (checksum and, if configured, signature) must pass
+	// before the download is exposed at TargetPath, so always fetch into
+	// a staging path first and only rename it into place once every
+	// check has passed. On any failure the staging file is removed and
+	// TargetPath is left untouched.
+	dst := d.config.TargetPath + ".verify"
+
+	if err := d.fetch(pwd, dst); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+
+	if len(d.config.SigningRootKeys) > 0 {
+		if err := d.verifySignature(dst); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+	}
+
+	if d.config.Hash != nil && len(d.config.Checksum) > 0 {
+		if err := d.verifyChecksum(dst); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+	}
+
+	if err := os.Rename(dst, d.config.TargetPath); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+
+	return d.config.TargetPath, nil
+}
+
+// transport returns the http.RoundTripper to use for the checksum-manifest,
+// signing-key, and signature requests a DownloadClient makes outside of
+// fetch, reusing d.config.Transport (e.g. a DownloadBatch's shared
+// transport) when one is configured instead of opening a fresh one per
+// request.
+func (d *DownloadClient) transport() http.RoundTripper {
+	if d.config.Transport != nil {
+		return d.config.Transport
+	}
+	return &http.Transport{Proxy: http.ProxyFromEnvironment}
+}
+
+// fetch retrieves d.config.Url into dst. When CopyFile is false, it
+// routes URLs whose scheme has an entry in DownloaderMap (by default
+// http/https, via HTTPDownloader) through that Downloader so
+// segmented/rate-limited downloads and Cancel actually apply. Every
+// other scheme, and every URL when CopyFile is true, goes through
+// go-getter.
+func (d *DownloadClient) fetch(pwd, dst string) error {
+	src, err := url.Parse(d.config.Url)
+	if err == nil && !d.config.CopyFile {
+		if downloader, ok := d.config.DownloaderMap[src.Scheme]; ok {
+			f, err := os.Create(dst)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			d.setDownloader(downloader)
+			if err := downloader.Download(f, src); err != nil {
+				log.Printf("Error Getting URL: %s", err)
+				return err
+			}
+
+			return nil
+		}
+	}
+
 	gc := getter.Client{
 		Src:  d.config.Url,
-		Dst:  d.config.TargetPath,
+		Dst:  dst,
 		Pwd:  pwd,
 		Mode: getter.ClientModeFile,
 		Dir:  false}
 
-	err = gc.Get()
-	if err != nil {
+	if err := gc.Get(); err != nil {
 		log.Printf("Error Getting URL: %s", err)
-		return "", err
+		return err
+	}
+
+	return nil
+}
+
+// resolveChecksumFromURL fetches the checksum manifest at
+// d.config.ChecksumURL, optionally verifying it against
+// d.config.ChecksumSignatureURL, and populates d.config.Hash/Checksum
+// from the entry matching the download's filename.
+func (d *DownloadClient) resolveChecksumFromURL() error {
+	httpClient := &http.Client{Transport: d.transport()}
+
+	body, err := httpGetBody(httpClient, d.config.ChecksumURL)
+	if err != nil {
+		return fmt.Errorf("checksum: fetching %s: %w", d.config.ChecksumURL, err)
 	}
 
-	return d.config.TargetPath, err
+	if d.config.ChecksumSignatureURL != "" {
+		if len(d.config.SigningRootKeys) == 0 {
+			return fmt.Errorf("checksum: ChecksumSignatureURL is set but no SigningRootKeys were configured to verify it")
+		}
+
+		sig, err := httpGetBody(httpClient, d.config.ChecksumSignatureURL)
+		if err != nil {
+			return fmt.Errorf("checksum: fetching checksum signature: %w", err)
+		}
+
+		v := d.verifierFactory()(d.config.SigningRootKeys)
+		if err := v.Verify(body, sig); err != nil {
+			return fmt.Errorf("checksum: manifest failed signature verification: %w", err)
+		}
+	}
+
+	src, err := url.Parse(d.config.Url)
+	filename := d.config.TargetPath
+	if err == nil && src.Path != "" {
+		filename = src.Path
+	}
+
+	digest, newHash, err := parseChecksumFile(body, filename, d.config.ChecksumType)
+	if err != nil {
+		return err
+	}
+
+	d.config.Hash = newHash()
+	d.config.Checksum = digest
+
+	return nil
+}
+
+// verifySignature checks the artifact at path against the signing-key
+// manifest pinned to d.config.SigningRootKeys, as described on
+// DownloadConfig.SigningKeysURL/SignatureURL.
+func (d *DownloadClient) verifySignature(path string) error {
+	httpClient := &http.Client{Transport: d.transport()}
+
+	newVerifier := d.verifierFactory()
+
+	keys, err := fetchSigningKeys(httpClient, d.config.SigningKeysURL, d.config.SigningRootKeys, newVerifier)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return verifyArtifactSignature(httpClient, d.config.Url, d.config.SignatureURL, data, keys, newVerifier)
+}
+
+// verifierFactory returns the function used to construct the Verifier
+// that checks the signing-key manifest and artifact signatures,
+// preferring d.config.NewVerifier and falling back to the default
+// Ed25519 scheme.
+func (d *DownloadClient) verifierFactory() func([][]byte) Verifier {
+	if d.config.NewVerifier != nil {
+		return d.config.NewVerifier
+	}
+	return defaultVerifierFactory
+}
+
+// verifyChecksum recomputes the configured hash over the file at path
+// and compares it against d.config.Checksum.
+func (d *DownloadClient) verifyChecksum(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d.config.Hash.Reset()
+	if _, err := io.Copy(d.config.Hash, f); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(d.config.Hash.Sum(nil), d.config.Checksum) {
+		return fmt.Errorf("checksum mismatch for %s", path)
+	}
+
+	return nil
 }
 
 // PercentProgress returns the download progress as a percentage.
 func (d *DownloadClient) PercentProgress() int {
-	if d.downloader == nil {
+	downloader := d.getDownloader()
+	if downloader == nil {
 		return -1
 	}
 
-	return int((float64(d.downloader.Progress()) / float64(d.downloader.Total())) * 100)
+	return int((float64(downloader.Progress()) / float64(downloader.Total())) * 100)
 }
 
+// defaultChunkSize is used for segmented downloads when
+// DownloadConfig.ChunkSize is unset.
+const defaultChunkSize int64 = 10 * 1024 * 1024
+
 // HTTPDownloader is an implementation of Downloader that downloads
-// files over HTTP.
+// files over HTTP. When the server supports range requests, reports a
+// Content-Length, and concurrency is configured above 1, it splits the
+// download into chunkSize-sized ranged GETs and runs up to concurrency
+// of them in parallel; otherwise
+// it falls back to the original single-stream path, which itself
+// resumes a partial download via a Range header when possible.
 type HTTPDownloader struct {
-	progress  uint
-	total     uint
-	userAgent string
+	progress    uint64
+	total       uint64
+	userAgent   string
+	concurrency int
+	chunkSize   int64
+	rateLimit   int64
+	rateLimiter *rate.Limiter
+	transport   http.RoundTripper
+	ctx         context.Context
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// setCancel records the CancelFunc for the in-flight Download call,
+// guarded by mu since it's read concurrently by Cancel.
+func (d *HTTPDownloader) setCancel(cancel context.CancelFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancel = cancel
 }
 
-func (*HTTPDownloader) Cancel() {
-	// TODO(mitchellh): Implement
+func (d *HTTPDownloader) Cancel() {
+	d.mu.Lock()
+	cancel := d.cancel
+	d.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (d *HTTPDownloader) httpClient() *http.Client {
+	transport := d.transport
+	if transport == nil {
+		transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+		}
+	}
+	return &http.Client{Transport: transport}
+}
+
+func (d *HTTPDownloader) newRequest(ctx context.Context, method string, src *url.URL) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, src.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+
+	return req, nil
 }
 
 func (d *HTTPDownloader) Download(dst *os.File, src *url.URL) error {
 	log.Printf("Starting download: %s", src.String())
 
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	d.setCancel(cancel)
+
 	// Seek to the beginning by default
 	if _, err := dst.Seek(0, 0); err != nil {
 		return err
 	}
 
 	// Reset our progress
-	d.progress = 0
+	atomic.StoreUint64(&d.progress, 0)
 
-	// Make the request. We first make a HEAD request so we can check
-	// if the server supports range queries. If the server/URL doesn't
-	// support HEAD requests, we just fall back to GET.
-	req, err := http.NewRequest("HEAD", src.String(), nil)
+	// Make a HEAD request so we can check if the server supports range
+	// queries and learn the total size. If the server/URL doesn't
+	// support HEAD requests, we just fall back to a plain GET.
+	headReq, err := d.newRequest(ctx, "HEAD", src)
 	if err != nil {
 		return err
 	}
 
-	if d.userAgent != "" {
-		req.Header.Set("User-Agent", d.userAgent)
+	httpClient := d.httpClient()
+
+	acceptsRanges := false
+	contentLength := int64(-1)
+
+	headResp, err := httpClient.Do(headReq)
+	if err == nil {
+		if headResp.StatusCode >= 200 && headResp.StatusCode < 300 {
+			acceptsRanges = headResp.Header.Get("Accept-Ranges") == "bytes"
+			contentLength = headResp.ContentLength
+		}
+		headResp.Body.Close()
 	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-		},
-	}
-
-	resp, err := httpClient.Do(req)
-	if err == nil && (resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		// If the HEAD request succeeded, then attempt to set the range
-		// query if we can.
-		if resp.Header.Get("Accept-Ranges") == "bytes" {
-			if fi, err := dst.Stat(); err == nil {
-				if _, err = dst.Seek(0, os.SEEK_END); err == nil {
-					req.Header.Set("Range", fmt.Sprintf("bytes=%d-", fi.Size()))
-					d.progress = uint(fi.Size())
-				}
+	if acceptsRanges && contentLength > 0 && d.concurrency > 1 {
+		return d.downloadRanged(ctx, dst, src, contentLength)
+	}
+
+	return d.downloadSequential(ctx, dst, src, acceptsRanges)
+}
+
+// downloadSequential is the original single-stream path: it resumes
+// from the current size of dst (via a Range header) when the server
+// supports ranges, and otherwise downloads the whole file from scratch.
+func (d *HTTPDownloader) downloadSequential(ctx context.Context, dst *os.File, src *url.URL, acceptsRanges bool) error {
+	req, err := d.newRequest(ctx, "GET", src)
+	if err != nil {
+		return err
+	}
+
+	if acceptsRanges {
+		if fi, err := dst.Stat(); err == nil {
+			if _, err = dst.Seek(0, os.SEEK_END); err == nil {
+				req.Header.Set("Range", fmt.Sprintf("bytes=%d-", fi.Size()))
+				atomic.StoreUint64(&d.progress, uint64(fi.Size()))
 			}
 		}
 	}
 
-	// Set the request to GET now, and redo the query to download
-	req.Method = "GET"
-
-	resp, err = httpClient.Do(req)
+	resp, err := d.httpClient().Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newHTTPStatusError(resp)
+	}
+
+	atomic.StoreUint64(&d.total, atomic.LoadUint64(&d.progress)+uint64(resp.ContentLength))
+
+	var r io.Reader = resp.Body
+	if limiter := d.limiter(); limiter != nil {
+		r = &rateLimitedReader{r: r, limiter: limiter, ctx: ctx}
+	}
 
-	d.total = d.progress + uint(resp.ContentLength)
 	var buffer [4096]byte
 	for {
-		n, err := resp.Body.Read(buffer[:])
+		n, err := r.Read(buffer[:])
 		if err != nil && err != io.EOF {
 			return err
 		}
 
-		d.progress += uint(n)
+		if n > 0 {
+			atomic.AddUint64(&d.progress, uint64(n))
+			if _, werr := dst.Write(buffer[:n]); werr != nil {
+				return werr
+			}
+		}
 
-		if _, werr := dst.Write(buffer[:n]); werr != nil {
-			return werr
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return nil
+}
+
+// downloadRanged splits [0, size) into chunkSize-sized segments and
+// fetches them concurrently, each via its own ranged GET, writing
+// directly into its slice of dst with WriteAt.
+func (d *HTTPDownloader) downloadRanged(ctx context.Context, dst *os.File, src *url.URL, size int64) error {
+	chunkSize := d.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	numChunks := int((size + chunkSize - 1) / chunkSize)
+	concurrency := d.concurrency
+	if concurrency > numChunks {
+		concurrency = numChunks
+	}
+
+	atomic.StoreUint64(&d.total, uint64(size))
+
+	limiter := d.limiter()
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, concurrency)
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+	}
+
+	for i := 0; i < numChunks; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := d.downloadChunk(ctx, dst, src, start, end, limiter); err != nil {
+				fail(err)
+			}
+		}(start, end)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+func (d *HTTPDownloader) downloadChunk(ctx context.Context, dst *os.File, src *url.URL, start, end int64, limiter *rate.Limiter) error {
+	req, err := d.newRequest(ctx, "GET", src)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := d.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return newHTTPStatusError(resp)
+	}
+
+	var r io.Reader = resp.Body
+	if limiter != nil {
+		r = &rateLimitedReader{r: r, limiter: limiter, ctx: ctx}
+	}
+
+	offset := start
+	var buffer [4096]byte
+	for {
+		n, err := r.Read(buffer[:])
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if n > 0 {
+			if _, werr := dst.WriteAt(buffer[:n], offset); werr != nil {
+				return werr
+			}
+			offset += int64(n)
+			atomic.AddUint64(&d.progress, uint64(n))
 		}
 
 		if err == io.EOF {
@@ -194,10 +691,52 @@ func (d *HTTPDownloader) Download(dst *os.File, src *url.URL) error {
 	return nil
 }
 
+// limiter returns the shared RateLimiter if one was configured,
+// otherwise a new limiter built from RateLimit if it was configured,
+// or nil for unlimited speed. All workers of a
+// segmented download share the same limiter so RateLimit bounds the
+// aggregate, not per-worker, throughput.
+func (d *HTTPDownloader) limiter() *rate.Limiter {
+	if d.rateLimiter != nil {
+		return d.rateLimiter
+	}
+
+	if d.rateLimit <= 0 {
+		return nil
+	}
+
+	// The burst must be able to absorb a single read's worth of bytes,
+	// or WaitN will reject it outright; our read buffer is 4096 bytes.
+	burst := int(d.rateLimit)
+	if burst < 4096 {
+		burst = 4096
+	}
+
+	return rate.NewLimiter(rate.Limit(d.rateLimit), burst)
+}
+
+// rateLimitedReader wraps a reader so that each Read call is throttled
+// against a shared rate.Limiter, in bytes/sec.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
 func (d *HTTPDownloader) Progress() uint {
-	return d.progress
+	return uint(atomic.LoadUint64(&d.progress))
 }
 
 func (d *HTTPDownloader) Total() uint {
-	return d.total
+	return uint(atomic.LoadUint64(&d.total))
 }
@@ -0,0 +1,326 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DownloadBatchConfig controls how DownloadBatch runs a set of
+// downloads: how many run at once, and how transient failures are
+// retried.
+type DownloadBatchConfig struct {
+	// Workers is the number of downloads to run concurrently. If <= 0,
+	// all downloads are run concurrently with no limit.
+	Workers int
+
+	// MaxRetries is the number of additional attempts made for a
+	// download that fails with a transient error (a network error or
+	// an HTTP 5xx/429 response). Zero means no retries.
+	MaxRetries int
+
+	// RetryBaseDelay is the base delay used for exponential backoff
+	// between retries. If zero, a 1 second base is used. A server's
+	// Retry-After header, when present on a 429/503 response, takes
+	// precedence over the computed backoff.
+	RetryBaseDelay time.Duration
+
+	// RateLimit caps the aggregate download speed, in bytes/sec,
+	// shared across every item in the batch. Zero means unlimited. It
+	// only applies to items that don't already set their own
+	// RateLimiter/RateLimit.
+	RateLimit int64
+}
+
+// DownloadResult is the outcome of a single item in a DownloadBatch.
+type DownloadResult struct {
+	// Config is the DownloadConfig this result corresponds to.
+	Config *DownloadConfig
+
+	// Path is the final path of the downloaded file, set only if Err
+	// is nil.
+	Path string
+
+	// Err is the error the download ultimately failed with, or nil on
+	// success.
+	Err error
+
+	// Bytes is the number of bytes transferred.
+	Bytes uint
+
+	// Elapsed is how long the download took, including retries.
+	Elapsed time.Duration
+
+	// Attempts is the number of attempts made, including the first.
+	Attempts int
+}
+
+// BatchProgress aggregates the progress of every DownloadConfig handed
+// to a DownloadBatch, for use by a UI that wants a single combined
+// percentage across all items while the batch is still running.
+type BatchProgress struct {
+	mu      sync.Mutex
+	clients []*DownloadClient
+}
+
+func (b *BatchProgress) set(i int, client *DownloadClient) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients[i] = client
+}
+
+// Progress returns the combined bytes transferred and combined total
+// across every download in the batch that has started. Downloads that
+// haven't started yet, or whose total isn't known yet, contribute 0 to
+// both.
+func (b *BatchProgress) Progress() (current, total uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.clients {
+		if c == nil {
+			continue
+		}
+		downloader := c.getDownloader()
+		if downloader == nil {
+			continue
+		}
+		current += downloader.Progress()
+		total += downloader.Total()
+	}
+	return current, total
+}
+
+// DownloadBatch downloads every config in configs concurrently, sharing
+// an HTTP transport and retrying transient failures with exponential
+// backoff. It returns immediately with a BatchProgress a caller can
+// poll, and a wait function that blocks until every download has
+// succeeded, failed with a permanent error, or exhausted its retries,
+// and returns one
+// DownloadResult per input config, in the same order as configs.
+func DownloadBatch(configs []*DownloadConfig, batchConfig *DownloadBatchConfig) (*BatchProgress, func() []*DownloadResult) {
+	if batchConfig == nil {
+		batchConfig = &DownloadBatchConfig{}
+	}
+
+	progress := &BatchProgress{clients: make([]*DownloadClient, len(configs))}
+
+	sharedTransport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+
+	var sharedLimiter *rate.Limiter
+	if batchConfig.RateLimit > 0 {
+		burst := int(batchConfig.RateLimit)
+		if burst < 4096 {
+			burst = 4096
+		}
+		sharedLimiter = rate.NewLimiter(rate.Limit(batchConfig.RateLimit), burst)
+	}
+
+	for _, config := range configs {
+		if config.Transport == nil {
+			config.Transport = sharedTransport
+		}
+		if sharedLimiter != nil && config.RateLimiter == nil && config.RateLimit <= 0 {
+			config.RateLimiter = sharedLimiter
+		}
+	}
+
+	workers := batchConfig.Workers
+	if workers <= 0 || workers > len(configs) {
+		workers = len(configs)
+	}
+
+	results := make([]*DownloadResult, len(configs))
+
+	var wg sync.WaitGroup
+	if workers > 0 {
+		jobs := make(chan int)
+
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					results[i] = downloadWithRetry(i, configs[i], batchConfig, progress)
+				}
+			}()
+		}
+
+		go func() {
+			for i := range configs {
+				jobs <- i
+			}
+			close(jobs)
+		}()
+	}
+
+	return progress, func() []*DownloadResult {
+		wg.Wait()
+		return results
+	}
+}
+
+// downloadWithRetry runs a single download, retrying transient
+// failures with exponential backoff (honoring Retry-After when the
+// failure came from a 429/503 response) up to batchConfig.MaxRetries
+// times.
+func downloadWithRetry(i int, config *DownloadConfig, batchConfig *DownloadBatchConfig, progress *BatchProgress) *DownloadResult {
+	result := &DownloadResult{Config: config}
+	start := time.Now()
+
+	baseDelay := batchConfig.RetryBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = time.Second
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= batchConfig.MaxRetries; attempt++ {
+		result.Attempts = attempt + 1
+
+		// Each attempt needs its own HTTPDownloaders: NewDownloadClient
+		// only populates DownloaderMap when it's nil, so reusing config
+		// as-is would silently hand every retry the first attempt's
+		// downloaders (and their already-used context) instead of a
+		// fresh one.
+		attemptConfig := *config
+		attemptConfig.DownloaderMap = nil
+
+		client := NewDownloadClient(&attemptConfig)
+		progress.set(i, client)
+
+		path, err := client.Get()
+		if err == nil {
+			result.Path = path
+			if downloader := client.getDownloader(); downloader != nil {
+				result.Bytes = downloader.Progress()
+			}
+			result.Elapsed = time.Since(start)
+			return result
+		}
+
+		lastErr = err
+		retryAfter, transient := classifyDownloadError(err)
+		if !transient || attempt == batchConfig.MaxRetries {
+			break
+		}
+
+		delay := retryAfter
+		if delay <= 0 {
+			delay = backoffDelay(baseDelay, attempt)
+		}
+		time.Sleep(delay)
+	}
+
+	result.Err = lastErr
+	result.Elapsed = time.Since(start)
+	return result
+}
+
+// classifyDownloadError reports whether err looks like a transient
+// network or server error worth retrying, and if it carries a
+// Retry-After hint, how long to wait before the next attempt. Anything
+// else — a checksum mismatch, a failed signature check, an unparseable
+// checksum manifest, an unknown ChecksumType, a permanent HTTP status —
+// is treated as permanent, since retrying it would just burn the full
+// MaxRetries budget on a download that can never succeed.
+func classifyDownloadError(err error) (retryAfter time.Duration, transient bool) {
+	if err == nil {
+		return 0, false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller asked us to stop, or set a deadline that passed;
+		// retrying would just repeat the same cancellation.
+		return 0, false
+	}
+
+	var httpErr *httpStatusError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.StatusCode == http.StatusTooManyRequests,
+			httpErr.StatusCode == http.StatusServiceUnavailable,
+			httpErr.StatusCode >= 500:
+			return httpErr.RetryAfter, true
+		default:
+			return 0, false
+		}
+	}
+
+	if isTransientNetError(err) {
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// isTransientNetError reports whether err looks like a transient
+// network-level failure (a timeout, or a connection reset/refused)
+// rather than an application-level failure that retrying can't fix.
+func isTransientNetError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// httpStatusError carries an HTTP response's status and any
+// Retry-After hint so retry logic can classify the failure without
+// re-parsing headers.
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d", e.StatusCode)
+}
+
+// newHTTPStatusError builds an httpStatusError from a non-2xx response,
+// capturing its Retry-After header if present so callers can back off
+// as the server asked rather than guessing.
+func newHTTPStatusError(resp *http.Response) *httpStatusError {
+	return &httpStatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter parses an HTTP Retry-After header, which is either a
+// number of seconds or an HTTP date; unparseable values are ignored.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// backoffDelay computes an exponential backoff delay for the given
+// attempt (0-indexed), with jitter to avoid every worker retrying a
+// flaky mirror in lockstep.
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << uint(attempt)
+	jitter := time.Duration(rand.Int63n(int64(base)))
+	return delay + jitter
+}
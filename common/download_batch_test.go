@@ -0,0 +1,231 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNetTimeoutError is a minimal net.Error that reports itself as a
+// timeout, for exercising classifyDownloadError's net.Error branch
+// without depending on a real network failure.
+type fakeNetTimeoutError struct{}
+
+func (fakeNetTimeoutError) Error() string   { return "fake: i/o timeout" }
+func (fakeNetTimeoutError) Timeout() bool   { return true }
+func (fakeNetTimeoutError) Temporary() bool { return true }
+
+func TestClassifyDownloadError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantTransient bool
+	}{
+		{"nil", nil, false},
+		{"checksum mismatch", fmt.Errorf("checksum mismatch for %s", "artifact.iso"), false},
+		{"signature failure", fmt.Errorf("distsign: artifact failed signature verification: boom"), false},
+		{"unknown checksum type", fmt.Errorf("checksum: unknown checksum type %q", "sha3"), false},
+		{"http 404", &httpStatusError{StatusCode: http.StatusNotFound}, false},
+		{"http 429", &httpStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"http 503", &httpStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"http 500", &httpStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"net timeout", fakeNetTimeoutError{}, true},
+		{"wrapped net timeout", fmt.Errorf("fetching: %w", fakeNetTimeoutError{}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, transient := classifyDownloadError(tt.err)
+			if transient != tt.wantTransient {
+				t.Fatalf("classifyDownloadError(%v) transient = %v, want %v", tt.err, transient, tt.wantTransient)
+			}
+		})
+	}
+}
+
+func TestClassifyDownloadError_ContextCancellation(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("fetch: %w", context.Canceled),
+		fmt.Errorf("fetch: %w", context.DeadlineExceeded),
+	} {
+		if _, transient := classifyDownloadError(err); transient {
+			t.Fatalf("expected %v to not be retried", err)
+		}
+	}
+}
+
+func TestClassifyDownloadError_RetryAfterFromHTTPError(t *testing.T) {
+	retryAfter, transient := classifyDownloadError(&httpStatusError{
+		StatusCode: http.StatusServiceUnavailable,
+		RetryAfter: 7 * time.Second,
+	})
+	if !transient {
+		t.Fatal("expected a 503 to be transient")
+	}
+	if retryAfter != 7*time.Second {
+		t.Fatalf("retryAfter = %s, want 7s", retryAfter)
+	}
+}
+
+// countingServer fails the first `failures` GET requests with status,
+// then succeeds. HEAD requests (Download's range/size probe) always
+// succeed and aren't counted, since the probe's own status never
+// determines whether the download attempt as a whole fails.
+func countingServer(t *testing.T, failures int, status int, body []byte) (*httptest.Server, *int32) {
+	t.Helper()
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		n := atomic.AddInt32(&count, 1)
+		if int(n) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &count
+}
+
+func TestDownloadBatch_RetriesTransientThenSucceeds(t *testing.T) {
+	body := []byte("artifact contents")
+	srv, count := countingServer(t, 2, http.StatusServiceUnavailable, body)
+
+	dir := t.TempDir()
+	configs := []*DownloadConfig{
+		{Url: srv.URL, TargetPath: filepath.Join(dir, "a")},
+	}
+
+	progress, wait := DownloadBatch(configs, &DownloadBatchConfig{
+		MaxRetries:     3,
+		RetryBaseDelay: time.Millisecond,
+	})
+	_ = progress
+
+	results := wait()
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("expected eventual success, got: %v", results[0].Err)
+	}
+	if results[0].Attempts != 3 {
+		t.Fatalf("Attempts = %d, want 3 (2 failures + 1 success)", results[0].Attempts)
+	}
+	if got := atomic.LoadInt32(count); got != 3 {
+		t.Fatalf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestDownloadBatch_PermanentErrorDoesNotRetry(t *testing.T) {
+	srv, count := countingServer(t, 100, http.StatusNotFound, nil)
+
+	dir := t.TempDir()
+	configs := []*DownloadConfig{
+		{Url: srv.URL, TargetPath: filepath.Join(dir, "a")},
+	}
+
+	_, wait := DownloadBatch(configs, &DownloadBatchConfig{
+		MaxRetries:     5,
+		RetryBaseDelay: time.Millisecond,
+	})
+
+	results := wait()
+	if results[0].Err == nil {
+		t.Fatal("expected a permanent 404 to surface as an error")
+	}
+	if results[0].Attempts != 1 {
+		t.Fatalf("Attempts = %d, want 1 (a 404 must not be retried)", results[0].Attempts)
+	}
+	if got := atomic.LoadInt32(count); got != 1 {
+		t.Fatalf("server saw %d requests, want 1", got)
+	}
+}
+
+func TestDownloadBatch_HonorsRetryAfterHeader(t *testing.T) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	configs := []*DownloadConfig{
+		{Url: srv.URL, TargetPath: filepath.Join(dir, "a")},
+	}
+
+	// RetryBaseDelay is large; if the 1-second Retry-After isn't honored
+	// in favor of a much larger computed backoff, the elapsed-time check
+	// below fails.
+	start := time.Now()
+	_, wait := DownloadBatch(configs, &DownloadBatchConfig{
+		MaxRetries:     1,
+		RetryBaseDelay: 10 * time.Second,
+	})
+	results := wait()
+	elapsed := time.Since(start)
+
+	if results[0].Err != nil {
+		t.Fatalf("expected eventual success, got: %v", results[0].Err)
+	}
+	if elapsed > 5*time.Second {
+		t.Fatalf("took %s, expected the 1s Retry-After to be used instead of the 10s computed backoff", elapsed)
+	}
+}
+
+func TestBatchProgress_ConcurrentPolling(t *testing.T) {
+	body := make([]byte, 50000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	configs := make([]*DownloadConfig, 5)
+	for i := range configs {
+		configs[i] = &DownloadConfig{Url: srv.URL, TargetPath: filepath.Join(dir, fmt.Sprintf("f%d", i))}
+	}
+
+	progress, wait := DownloadBatch(configs, &DownloadBatchConfig{Workers: 3})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				progress.Progress()
+			}
+		}
+	}()
+
+	results := wait()
+	close(stop)
+	wg.Wait()
+
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("download %d failed: %v", i, r.Err)
+		}
+	}
+}